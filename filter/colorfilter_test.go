@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMarginalColorFilterMatchesPerChannelBruteForce(t *testing.T) {
+	const height, width, radius = 24, 24, 2
+
+	rng := rand.New(rand.NewSource(3))
+	r := makeMatrix(height, width)
+	g := makeMatrix(height, width)
+	b := makeMatrix(height, width)
+	for i := 0; i < height; i++ {
+		for j := 0; j < width; j++ {
+			r[i][j] = uint8(rng.Intn(256))
+			g[i][j] = uint8(rng.Intn(256))
+			b[i][j] = uint8(rng.Intn(256))
+		}
+	}
+	immutableR, immutableG, immutableB := makeImmutableMatrix(r), makeImmutableMatrix(g), makeImmutableMatrix(b)
+
+	dest := make([][]colorPixel, height)
+	for i := range dest {
+		dest[i] = make([]colorPixel, width)
+	}
+	strategy := marginalColorFilter{r: immutableR, g: immutableG, b: immutableB, radius: radius}
+	strategy.filterColorTile(0, height, 0, width, dest)
+
+	for y := radius; y < height-radius; y++ {
+		for x := radius; x < width-radius; x++ {
+			want := colorPixel{
+				r: bruteForceMedian(y, x, radius, immutableR),
+				g: bruteForceMedian(y, x, radius, immutableG),
+				b: bruteForceMedian(y, x, radius, immutableB),
+			}
+			if got := dest[y][x]; got != want {
+				t.Fatalf("(%d,%d): got %+v, want %+v", y, x, got, want)
+			}
+		}
+	}
+}
+
+func TestVectorColorFilterPicksConsensusPixelOverOutlier(t *testing.T) {
+	// A radius-1 (3x3) window where every sample is the same color except one outlier: the
+	// consensus color has the smallest summed distance to every other sample, so the vector
+	// median filter should reproduce it exactly rather than inventing a blend.
+	const radius = 1
+	consensus := colorPixel{r: 40, g: 80, b: 120}
+	outlier := colorPixel{r: 250, g: 10, b: 5}
+
+	window := make([][]colorPixel, 3)
+	for i := range window {
+		window[i] = make([]colorPixel, 3)
+		for j := range window[i] {
+			window[i][j] = consensus
+		}
+	}
+	window[0][0] = outlier
+
+	at := func(plane func(p colorPixel) uint8) func(y, x int) uint8 {
+		return func(y, x int) uint8 { return plane(window[y][x]) }
+	}
+	strategy := vectorColorFilter{
+		r:      at(func(p colorPixel) uint8 { return p.r }),
+		g:      at(func(p colorPixel) uint8 { return p.g }),
+		b:      at(func(p colorPixel) uint8 { return p.b }),
+		radius: radius,
+	}
+
+	dest := make([][]colorPixel, 3)
+	for i := range dest {
+		dest[i] = make([]colorPixel, 3)
+	}
+	strategy.filterColorTile(0, 3, 0, 3, dest)
+
+	if dest[1][1] != consensus {
+		t.Fatalf("dest[1][1] = %+v, want consensus %+v", dest[1][1], consensus)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// makeTestGrayImage builds a small image.Gray with distinct, easily hand-traced pixel values.
+func makeTestGrayImage() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	values := [2][3]uint8{
+		{0, 10, 20},
+		{30, 40, 50},
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			img.SetGray(x, y, color.Gray{Y: values[y][x]})
+		}
+	}
+	return img
+}
+
+func TestWriteImageDispatchesByExtension(t *testing.T) {
+	dir := t.TempDir()
+	img := makeTestGrayImage()
+
+	t.Run("png round-trips exactly", func(t *testing.T) {
+		path := filepath.Join(dir, "out.png")
+		if err := writeImage(path, img, 95); err != nil {
+			t.Fatalf("writeImage: %v", err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("os.Open: %v", err)
+		}
+		defer f.Close()
+		got, err := png.Decode(f)
+		if err != nil {
+			t.Fatalf("png.Decode: %v", err)
+		}
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 3; x++ {
+				if got.At(x, y) != img.At(x, y) {
+					t.Fatalf("(%d,%d): got %v, want %v", x, y, got.At(x, y), img.At(x, y))
+				}
+			}
+		}
+	})
+
+	t.Run("jpg is a decodable JPEG", func(t *testing.T) {
+		path := filepath.Join(dir, "out.jpg")
+		if err := writeImage(path, img, 95); err != nil {
+			t.Fatalf("writeImage: %v", err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("os.Open: %v", err)
+		}
+		defer f.Close()
+		if _, err := jpeg.Decode(f); err != nil {
+			t.Fatalf("jpeg.Decode: %v", err)
+		}
+	})
+
+	t.Run("tiff round-trips exactly", func(t *testing.T) {
+		path := filepath.Join(dir, "out.tiff")
+		if err := writeImage(path, img, 95); err != nil {
+			t.Fatalf("writeImage: %v", err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("os.Open: %v", err)
+		}
+		defer f.Close()
+		got, err := tiff.Decode(f)
+		if err != nil {
+			t.Fatalf("tiff.Decode: %v", err)
+		}
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 3; x++ {
+				gr, gg, gb, ga := got.At(x, y).RGBA()
+				wr, wg, wb, wa := img.At(x, y).RGBA()
+				if gr != wr || gg != wg || gb != wb || ga != wa {
+					t.Fatalf("(%d,%d): got %v, want %v", x, y, got.At(x, y), img.At(x, y))
+				}
+			}
+		}
+	})
+
+	t.Run("unrecognized extension errors without creating a file", func(t *testing.T) {
+		path := filepath.Join(dir, "out.xyz")
+		if err := writeImage(path, img, 95); err == nil {
+			t.Fatal("writeImage: expected an error for an unrecognized extension")
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("writeImage: left a file behind at %q despite failing", path)
+		}
+	})
+}
+
+func TestWritePGMRoundTrips(t *testing.T) {
+	img := makeTestGrayImage()
+
+	var buf bytes.Buffer
+	if err := writePGM(&buf, img); err != nil {
+		t.Fatalf("writePGM: %v", err)
+	}
+
+	r := bufio.NewReader(&buf)
+	var magic string
+	var width, height, maxVal int
+	if _, err := fmt.Fscan(r, &magic, &width, &height, &maxVal); err != nil {
+		t.Fatalf("parsing PGM header: %v", err)
+	}
+	if magic != "P5" || width != 3 || height != 2 || maxVal != 255 {
+		t.Fatalf("header = %q %d %d %d, want P5 3 2 255", magic, width, height, maxVal)
+	}
+	// fmt.Fscan leaves the reader positioned right after maxVal; the single whitespace byte
+	// separating the header from the binary payload still needs to be consumed.
+	if _, err := r.ReadByte(); err != nil {
+		t.Fatalf("consuming header/payload separator: %v", err)
+	}
+
+	pixels := make([]byte, width*height)
+	if _, err := r.Read(pixels); err != nil {
+		t.Fatalf("reading pixel payload: %v", err)
+	}
+
+	want := []byte{0, 10, 20, 30, 40, 50}
+	if !bytes.Equal(pixels, want) {
+		t.Fatalf("pixels = %v, want %v", pixels, want)
+	}
+}
+
+func TestWritePPMRoundTrips(t *testing.T) {
+	img := makeTestGrayImage() // grayscale R==G==B at every pixel
+
+	var buf bytes.Buffer
+	if err := writePPM(&buf, img); err != nil {
+		t.Fatalf("writePPM: %v", err)
+	}
+
+	r := bufio.NewReader(&buf)
+	var magic string
+	var width, height, maxVal int
+	if _, err := fmt.Fscan(r, &magic, &width, &height, &maxVal); err != nil {
+		t.Fatalf("parsing PPM header: %v", err)
+	}
+	if magic != "P6" || width != 3 || height != 2 || maxVal != 255 {
+		t.Fatalf("header = %q %d %d %d, want P6 3 2 255", magic, width, height, maxVal)
+	}
+	if _, err := r.ReadByte(); err != nil {
+		t.Fatalf("consuming header/payload separator: %v", err)
+	}
+
+	pixels := make([]byte, width*height*3)
+	if _, err := r.Read(pixels); err != nil {
+		t.Fatalf("reading pixel payload: %v", err)
+	}
+
+	grayValues := []byte{0, 10, 20, 30, 40, 50}
+	for i, v := range grayValues {
+		got := [3]byte{pixels[i*3], pixels[i*3+1], pixels[i*3+2]}
+		want := [3]byte{v, v, v}
+		if got != want {
+			t.Fatalf("pixel %d = %v, want %v", i, got, want)
+		}
+	}
+}
+
+// exifOrientationTestCases hand-derives the displayed pixel grid for every EXIF orientation value
+// (1-8) from a 3-wide, 2-tall source image with values v[y][x], independent of orientedImage's
+// own implementation, so the test actually catches a wrong remap rather than mirroring it.
+func exifOrientationTestCases() []struct {
+	orientation int
+	want        [][]uint8
+} {
+	return []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{1, [][]uint8{{0, 10, 20}, {30, 40, 50}}},
+		{2, [][]uint8{{20, 10, 0}, {50, 40, 30}}},
+		{3, [][]uint8{{50, 40, 30}, {20, 10, 0}}},
+		{4, [][]uint8{{30, 40, 50}, {0, 10, 20}}},
+		{5, [][]uint8{{0, 30}, {10, 40}, {20, 50}}},
+		{6, [][]uint8{{30, 0}, {40, 10}, {50, 20}}},
+		{7, [][]uint8{{50, 20}, {40, 10}, {30, 0}}},
+		{8, [][]uint8{{20, 50}, {10, 40}, {0, 30}}},
+	}
+}
+
+func TestOrientedImageRemapsAllEightOrientations(t *testing.T) {
+	src := makeTestGrayImage()
+
+	for _, tc := range exifOrientationTestCases() {
+		t.Run(fmt.Sprintf("orientation %d", tc.orientation), func(t *testing.T) {
+			oriented := orientedImage{Image: src, orientation: tc.orientation}
+			bounds := oriented.Bounds()
+
+			wantHeight := len(tc.want)
+			wantWidth := len(tc.want[0])
+			if bounds.Dx() != wantWidth || bounds.Dy() != wantHeight {
+				t.Fatalf("Bounds() = %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), wantWidth, wantHeight)
+			}
+
+			for y := 0; y < wantHeight; y++ {
+				for x := 0; x < wantWidth; x++ {
+					got := color.GrayModel.Convert(oriented.At(x, y)).(color.Gray).Y
+					if got != tc.want[y][x] {
+						t.Fatalf("At(%d,%d) = %d, want %d", x, y, got, tc.want[y][x])
+					}
+				}
+			}
+		})
+	}
+}
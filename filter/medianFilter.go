@@ -1,14 +1,35 @@
 package main
 
 import (
+	"encoding/binary"
 	"flag"
+	"fmt"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"image/png"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
 	"sort"
+	"strings"
+	"sync"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
 )
 
+// registerFormats registers the image codecs filter and stackFilter decode from. png and jpeg
+// also register themselves on import, but are kept explicit here for clarity; bmp registers
+// itself as a side effect of its blank import above, and tiff does the same as well as
+// providing the Encode used by writeImage.
+func registerFormats() {
+	image.RegisterFormat("png", "PNG", png.Decode, png.DecodeConfig)
+	image.RegisterFormat("jpeg", "jpeg", jpeg.Decode, jpeg.DecodeConfig)
+}
+
 // check handles a potential error.
 // It stops execution of the program ("panics") if an error has happened.
 func check(err error) {
@@ -33,38 +54,219 @@ func makeImmutableMatrix(matrix [][]uint8) func(y, x int) uint8 {
 	}
 }
 
-func worker(startY, endY, startX, endX int, data func(y, x int) uint8, out chan<- [][]uint8) {
-	// 1. 在 startY 到 endY 和 startX 到 endX 范围内应用中值滤波器
-	filteredData := medianFilter(startY, endY, startX, endX, data)
-	// 2. 将结果发送到通道
-	out <- filteredData
+// filterStrategy abstracts over how a range of output pixels is produced, so the worker pool
+// below can drive either the single-frame spatial median or the multi-frame temporal median
+// without caring which one it's running. filterTile writes its results directly into dest
+// (indexed by the same absolute coordinates as startY/endY/startX/endX), which must span the
+// full output image: this lets every worker share one pre-allocated destination with no
+// per-tile allocation or copying.
+type filterStrategy interface {
+	filterTile(startY, endY, startX, endX int, dest [][]uint8)
+}
+
+// spatialFilter runs the NxN (N = 2*radius+1) spatial median filter against a single frame.
+type spatialFilter struct {
+	data   func(y, x int) uint8
+	radius int
+}
+
+func (s spatialFilter) filterTile(startY, endY, startX, endX int, dest [][]uint8) {
+	medianFilter(startY, endY, startX, endX, s.radius, len(dest), len(dest[0]), s.data, dest)
+}
+
+// temporalFilter computes, for every pixel position, the median value across an ordered set
+// of aligned frames -- the classic "remove moving objects" stacking technique.
+type temporalFilter struct {
+	frames []func(y, x int) uint8
+}
+
+func (t temporalFilter) filterTile(startY, endY, startX, endX int, dest [][]uint8) {
+	for i := startY; i < endY; i++ {
+		for j := startX; j < endX; j++ {
+			dest[i][j] = medianOfFrames(i, j, t.frames)
+		}
+	}
+}
+
+// medianOfFrames returns the per-pixel median across frames at position (y, x). Like
+// medianFilter, it takes the lower-middle sample when the number of inputs is even.
+func medianOfFrames(y, x int, frames []func(y, x int) uint8) uint8 {
+	samples := make([]int, len(frames))
+	for i, frame := range frames {
+		samples[i] = int(frame(y, x))
+	}
+	sort.Ints(samples)
+	return uint8(samples[(len(samples)-1)/2])
+}
+
+// clampRange trims [start, end) to [radius, limit-radius), the border handling medianFilter has
+// always used: pixels within radius of the image edge are left unfiltered rather than read out
+// of bounds. Unlike the old per-tile trim, this clamps against the image's true edges (limit),
+// not a tile's own boundary, so the rows/columns a tile borrows from its neighbors are still
+// filtered instead of left as an unfiltered seam.
+func clampRange(start, end, radius, limit int) (int, int) {
+	if start < radius {
+		start = radius
+	}
+	if end > limit-radius {
+		end = limit - radius
+	}
+	return start, end
 }
 
-// medianFilter applies the filter between the given x and y bounds on the given closure.
-// medianFilter returns the section where the filter was applied as a 2D slice.
-func medianFilter(startY, endY, startX, endX int, data func(y, x int) uint8) [][]uint8 {
-	height := endY - startY
-	width := endX - startX
-	radius := 2
-	midPoint := (5*5 + 1) / 2
+// slidingMedianRow computes Huang's sliding-histogram median across row i with a square window
+// 2*radius+1 wide for columns [colStart, colEnd), calling set for each column's median in turn.
+func slidingMedianRow(i, colStart, colEnd, radius int, data func(y, x int) uint8, set func(j, median int)) {
+	kernelSize := 2*radius + 1
+	medianRank := (kernelSize*kernelSize + 1) / 2
+
+	var hist [256]int
+	for k := i - radius; k <= i+radius; k++ {
+		for l := colStart - radius; l <= colStart+radius; l++ {
+			hist[data(k, l)]++
+		}
+	}
+	median, countLE := advanceMedian(&hist, 0, hist[0], medianRank)
+
+	for j := colStart; j < colEnd; j++ {
+		if j > colStart {
+			leaving, entering := j-radius-1, j+radius
+			for k := i - radius; k <= i+radius; k++ {
+				lv := data(k, leaving)
+				hist[lv]--
+				if int(lv) <= median {
+					countLE--
+				}
+				ev := data(k, entering)
+				hist[ev]++
+				if int(ev) <= median {
+					countLE++
+				}
+			}
+			median, countLE = advanceMedian(&hist, median, countLE, medianRank)
+		}
+		set(j, median)
+	}
+}
+
+// medianFilter applies the NxN (N = 2*radius+1) median filter to the row range [startY, endY)
+// and column range [startX, endX), writing results directly into dest. height and width are the
+// full image's dimensions (dest may be a shared, pre-allocated buffer larger than this tile), so
+// the radius-wide border left unfiltered is trimmed against the true image edges rather than
+// this tile's own boundary -- letting data (the full immutable source) supply whatever overlap
+// a tile needs from its neighbors.
+func medianFilter(startY, endY, startX, endX, radius, height, width int, data func(y, x int) uint8, dest [][]uint8) {
+	rowStart, rowEnd := clampRange(startY, endY, radius, height)
+	colStart, colEnd := clampRange(startX, endX, radius, width)
+
+	for i := rowStart; i < rowEnd; i++ {
+		slidingMedianRow(i, colStart, colEnd, radius, data, func(j, median int) {
+			dest[i][j] = uint8(median)
+		})
+	}
+}
+
+// advanceMedian walks the coarse median pointer into hist up or down until the cumulative count
+// of bins at or below it crosses medianRank -- the "coarse histogram" step of Huang's algorithm,
+// called once to seed a row's median and again after every single-column histogram update.
+func advanceMedian(hist *[256]int, median, countLE, medianRank int) (int, int) {
+	for countLE < medianRank {
+		median++
+		countLE += hist[median]
+	}
+	for countLE-hist[median] >= medianRank {
+		countLE -= hist[median]
+		median--
+	}
+	return median, countLE
+}
+
+// colorPixel is an RGB triplet carried through the color filter pipelines.
+type colorPixel struct {
+	r, g, b uint8
+}
+
+// colorFilterStrategy abstracts over the two color median strategies -- marginal and vector --
+// mirroring filterStrategy for the grayscale pipeline but operating on RGB triplets. Like
+// filterTile, filterColorTile writes directly into a shared, pre-allocated dest.
+type colorFilterStrategy interface {
+	filterColorTile(startY, endY, startX, endX int, dest [][]colorPixel)
+}
+
+// marginalColorFilter runs the existing NxN spatial median filter independently on each of the
+// R, G and B planes. It's cheap but can bleed color at sharp edges, since the three channels'
+// medians aren't guaranteed to come from the same source pixel.
+type marginalColorFilter struct {
+	r, g, b func(y, x int) uint8
+	radius  int
+}
+
+func (m marginalColorFilter) filterColorTile(startY, endY, startX, endX int, dest [][]colorPixel) {
+	rowStart, rowEnd := clampRange(startY, endY, m.radius, len(dest))
+	colStart, colEnd := clampRange(startX, endX, m.radius, len(dest[0]))
+
+	for i := rowStart; i < rowEnd; i++ {
+		slidingMedianRow(i, colStart, colEnd, m.radius, m.r, func(j, median int) {
+			dest[i][j].r = uint8(median)
+		})
+		slidingMedianRow(i, colStart, colEnd, m.radius, m.g, func(j, median int) {
+			dest[i][j].g = uint8(median)
+		})
+		slidingMedianRow(i, colStart, colEnd, m.radius, m.b, func(j, median int) {
+			dest[i][j].b = uint8(median)
+		})
+	}
+}
+
+// vectorColorFilter is the vector median filter: for each window it picks the input pixel whose
+// summed Euclidean distance in RGB space to the other window samples is smallest, and copies
+// that pixel verbatim. Unlike the marginal filter it never invents a color that wasn't in the
+// window, which avoids the color-bleeding artifacts marginal filtering produces at edges.
+type vectorColorFilter struct {
+	r, g, b func(y, x int) uint8
+	radius  int
+}
+
+func (v vectorColorFilter) filterColorTile(startY, endY, startX, endX int, dest [][]colorPixel) {
+	radius := v.radius
+	kernelSize := (2*radius + 1) * (2*radius + 1)
+
+	rowStart, rowEnd := clampRange(startY, endY, radius, len(dest))
+	colStart, colEnd := clampRange(startX, endX, radius, len(dest[0]))
 
-	filteredMatrix := makeMatrix(height, width)
-	filterValues := make([]int, 5*5)
+	window := make([]colorPixel, kernelSize)
 
-	for i := radius + startY; i < endY-radius; i++ {
-		for j := radius + startX; j < endX-radius; j++ {
+	for i := rowStart; i < rowEnd; i++ {
+		for j := colStart; j < colEnd; j++ {
 			count := 0
 			for k := i - radius; k <= i+radius; k++ {
 				for l := j - radius; l <= j+radius; l++ {
-					filterValues[count] = int(data(k, l))
+					window[count] = colorPixel{v.r(k, l), v.g(k, l), v.b(k, l)}
 					count++
 				}
 			}
-			sort.Ints(filterValues)
-			filteredMatrix[i-startY][j-startX] = uint8(filterValues[midPoint])
+
+			best := 0
+			bestDist := math.MaxFloat64
+			for a := range window {
+				dist := 0.0
+				for c := range window {
+					if a == c {
+						continue
+					}
+					dr := float64(window[a].r) - float64(window[c].r)
+					dg := float64(window[a].g) - float64(window[c].g)
+					db := float64(window[a].b) - float64(window[c].b)
+					dist += math.Sqrt(dr*dr + dg*dg + db*db)
+				}
+				if dist < bestDist {
+					bestDist = dist
+					best = a
+				}
+			}
+			dest[i][j] = window[best]
 		}
 	}
-	return filteredMatrix
 }
 
 // getPixelData transfers an image.Image to a standard 2D slice.
@@ -84,18 +286,167 @@ func getPixelData(img image.Image) [][]uint8 {
 	return pixels
 }
 
-// loadImage opens a file and returns the contents as an image.Image.
+// getPixelDataRGB transfers an image.Image into three 2D slices, one per RGB channel, for
+// callers that need to preserve color instead of collapsing to luminance like getPixelData does.
+func getPixelDataRGB(img image.Image) (r, g, b [][]uint8) {
+	bounds := img.Bounds()
+	r = makeMatrix(bounds.Dy(), bounds.Dx())
+	g = makeMatrix(bounds.Dy(), bounds.Dx())
+	b = makeMatrix(bounds.Dy(), bounds.Dx())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pr, pg, pb, _ := img.At(x, y).RGBA()
+			r[y][x] = uint8(pr / 256)
+			g[y][x] = uint8(pg / 256)
+			b[y][x] = uint8(pb / 256)
+		}
+	}
+	return r, g, b
+}
+
+// loadImage opens a file and returns the contents as an image.Image. JPEGs carrying an EXIF
+// Orientation tag are rotated/flipped to match how the photo was held when it was taken, so a
+// portrait phone photo doesn't come out sideways.
 func loadImage(filepath string) image.Image {
 	existingImageFile, err := os.Open(filepath)
 	check(err)
 	defer existingImageFile.Close()
 
-	img, _, err := image.Decode(existingImageFile)
+	img, format, err := image.Decode(existingImageFile)
 	check(err)
 
+	if format == "jpeg" {
+		if orientation := readJPEGOrientation(filepath); orientation != 1 {
+			img = orientedImage{Image: img, orientation: orientation}
+		}
+	}
+
 	return img
 }
 
+// orientedImage wraps a decoded image.Image and remaps coordinate lookups according to an EXIF
+// Orientation value (1-8), so downstream pixel extraction sees the photo the way it was held
+// when taken instead of however the camera happened to store the sensor data.
+type orientedImage struct {
+	image.Image
+	orientation int
+}
+
+func (o orientedImage) Bounds() image.Rectangle {
+	b := o.Image.Bounds()
+	if o.orientation >= 5 {
+		return image.Rect(0, 0, b.Dy(), b.Dx())
+	}
+	return image.Rect(0, 0, b.Dx(), b.Dy())
+}
+
+func (o orientedImage) At(x, y int) color.Color {
+	b := o.Image.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	switch o.orientation {
+	case 2: // flip horizontal
+		return o.Image.At(b.Min.X+w-1-x, b.Min.Y+y)
+	case 3: // rotate 180
+		return o.Image.At(b.Min.X+w-1-x, b.Min.Y+h-1-y)
+	case 4: // flip vertical
+		return o.Image.At(b.Min.X+x, b.Min.Y+h-1-y)
+	case 5: // transpose
+		return o.Image.At(b.Min.X+y, b.Min.Y+x)
+	case 6: // rotate 90 CW
+		return o.Image.At(b.Min.X+y, b.Min.Y+h-1-x)
+	case 7: // transverse
+		return o.Image.At(b.Min.X+w-1-y, b.Min.Y+h-1-x)
+	case 8: // rotate 270 CW
+		return o.Image.At(b.Min.X+w-1-y, b.Min.Y+x)
+	default:
+		return o.Image.At(b.Min.X+x, b.Min.Y+y)
+	}
+}
+
+// readJPEGOrientation scans a JPEG file's APP1 segment for an embedded EXIF Orientation tag and
+// returns its value, or 1 (no rotation) if the file has no EXIF data or no Orientation tag.
+func readJPEGOrientation(filepath string) int {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return 1
+	}
+	defer f.Close()
+
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(f, soi); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return 1
+	}
+
+	for {
+		marker := make([]byte, 2)
+		if _, err := io.ReadFull(f, marker); err != nil || marker[0] != 0xFF {
+			return 1
+		}
+		if marker[1] == 0xDA { // start of scan: image data follows, no more markers to inspect
+			return 1
+		}
+
+		lengthBytes := make([]byte, 2)
+		if _, err := io.ReadFull(f, lengthBytes); err != nil {
+			return 1
+		}
+		segmentLen := int(binary.BigEndian.Uint16(lengthBytes))
+		if segmentLen < 2 {
+			return 1
+		}
+
+		segment := make([]byte, segmentLen-2)
+		if _, err := io.ReadFull(f, segment); err != nil {
+			return 1
+		}
+
+		if marker[1] == 0xE1 && len(segment) > 6 && string(segment[0:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+	}
+}
+
+// exifOrientation parses a TIFF-structured EXIF blob (the payload following the "Exif\0\0"
+// marker in a JPEG's APP1 segment) and returns the Orientation tag's value, or 1 if the tag
+// isn't present.
+func exifOrientation(blob []byte) int {
+	if len(blob) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(blob[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifdOffset := order.Uint32(blob[4:8])
+	if int(ifdOffset)+2 > len(blob) {
+		return 1
+	}
+
+	entryCount := int(order.Uint16(blob[ifdOffset : ifdOffset+2]))
+	entriesStart := int(ifdOffset) + 2
+
+	const orientationTag = 0x0112
+	for i := 0; i < entryCount; i++ {
+		entryStart := entriesStart + i*12
+		if entryStart+10 > len(blob) {
+			break
+		}
+		if order.Uint16(blob[entryStart:entryStart+2]) == orientationTag {
+			return int(order.Uint16(blob[entryStart+8 : entryStart+10]))
+		}
+	}
+	return 1
+}
+
 // flattenImage takes a 2D slice and flattens it into a single 1D slice.
 func flattenImage(image [][]uint8) []uint8 {
 	height := len(image)
@@ -108,78 +459,313 @@ func flattenImage(image [][]uint8) []uint8 {
 	return flattenedImage
 }
 
-// filter reads in a png image, applies the filter and outputs the result as a png image.
-// filter is the function called by the tests in medianfilter_test.go
-func filter(filepathIn, filepathOut string, threads int) {
-	image.RegisterFormat("png", "PNG", png.Decode, png.DecodeConfig)
-	image.RegisterFormat("jpeg", "jpeg", jpeg.Decode, jpeg.DecodeConfig)
+// flattenColorImage lays out a 2D colorPixel slice as NRGBA bytes (R, G, B, A per pixel), ready
+// to assign to an image.NRGBA's Pix.
+func flattenColorImage(pixels [][]colorPixel) []uint8 {
+	height := len(pixels)
+	width := len(pixels[0])
 
-	img := loadImage(filepathIn)
+	flattened := make([]uint8, 0, height*width*4)
+	for i := 0; i < height; i++ {
+		for j := 0; j < width; j++ {
+			p := pixels[i][j]
+			flattened = append(flattened, p.r, p.g, p.b, 255)
+		}
+	}
+	return flattened
+}
+
+// writeImage encodes img to filepathOut, choosing the codec from the file's extension: .png,
+// .jpg/.jpeg (at the given quality), .tiff/.tif, or .pgm/.ppm for a raw, uncompressed netpbm
+// image that composes cleanly with Unix pipelines.
+func writeImage(filepathOut string, img image.Image, quality int) error {
+	var encode func(w io.Writer) error
+
+	switch ext := strings.ToLower(filepath.Ext(filepathOut)); ext {
+	case ".png", "":
+		encode = func(w io.Writer) error { return png.Encode(w, img) }
+	case ".jpg", ".jpeg":
+		encode = func(w io.Writer) error { return jpeg.Encode(w, img, &jpeg.Options{Quality: quality}) }
+	case ".tiff", ".tif":
+		encode = func(w io.Writer) error { return tiff.Encode(w, img, nil) }
+	case ".pgm":
+		encode = func(w io.Writer) error { return writePGM(w, img) }
+	case ".ppm":
+		encode = func(w io.Writer) error { return writePPM(w, img) }
+	default:
+		return fmt.Errorf("writeImage: unrecognized output extension %q", ext)
+	}
+
+	ofp, err := os.Create(filepathOut)
+	if err != nil {
+		return err
+	}
+	defer ofp.Close()
+
+	return encode(ofp)
+}
+
+// writePGM writes img as a binary (P5) grayscale netpbm file.
+func writePGM(w io.Writer, img image.Image) error {
 	bounds := img.Bounds()
-	height := bounds.Dy()
-	width := bounds.Dx()
+	width, height := bounds.Dx(), bounds.Dy()
 
-	immutableData := makeImmutableMatrix(getPixelData(img))
-	var newPixelData [][]uint8
+	if _, err := fmt.Fprintf(w, "P5\n%d %d\n255\n", width, height); err != nil {
+		return err
+	}
 
-	if threads == 1 {
-		newPixelData = medianFilter(0, height, 0, width, immutableData)
-	} else {
-		// 多线程处理图像
-		resultChan := make([]chan [][]uint8, threads)
-		partitionSize := height / threads
+	row := make([]byte, width)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			row[x-bounds.Min.X] = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		// 初始化通道
-		for i := 0; i < threads; i++ {
-			resultChan[i] = make(chan [][]uint8)
+// writePPM writes img as a binary (P6) RGB netpbm file.
+func writePPM(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if _, err := fmt.Fprintf(w, "P6\n%d %d\n255\n", width, height); err != nil {
+		return err
+	}
+
+	row := make([]byte, width*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			i := (x - bounds.Min.X) * 3
+			row[i] = uint8(r / 256)
+			row[i+1] = uint8(g / 256)
+			row[i+2] = uint8(b / 256)
 		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		// 启动多个线程
-		for t := 0; t < threads; t++ {
-			startY := t * partitionSize
-			endY := (t + 1) * partitionSize
-			if t == threads-1 {
-				endY = height
-			}
+// tileHeight is the row span of one unit of work handed to a worker. Smaller than most images,
+// so most images split into several tiles for the workers to share; an image with fewer tiles
+// than workers gets only as many workers as it has tiles (see runTiles).
+const tileHeight = 64
 
-			// 使用 worker 函数启动每个 goroutine
-			go worker(startY, endY, 0, width, immutableData, resultChan[t])
+// tileJob describes one disjoint row range of output pixels. Jobs never overlap, so workers can
+// write into a shared destination slice without any synchronization between them.
+type tileJob struct {
+	startY, endY int
+}
+
+// newTileJobs splits [0, height) into fixed-height row tiles.
+func newTileJobs(height int) []tileJob {
+	jobs := make([]tileJob, 0, (height+tileHeight-1)/tileHeight)
+	for startY := 0; startY < height; startY += tileHeight {
+		endY := startY + tileHeight
+		if endY > height {
+			endY = height
 		}
+		jobs = append(jobs, tileJob{startY, endY})
+	}
+	return jobs
+}
 
-		// 创建最终的图像矩阵
-		newPixelData = makeMatrix(height, width)
+// workerCount resolves the -threads flag to a concrete pool size: threads if positive, or every
+// available CPU if it's 0 (unset).
+func workerCount(threads int) int {
+	if threads > 0 {
+		return threads
+	}
+	return runtime.NumCPU()
+}
 
-		// 收集所有线程的处理结果
-		for t := 0; t < threads; t++ {
-			partialResult := <-resultChan[t]
-			startY := t * partitionSize
-			for i := startY; i < startY+len(partialResult); i++ {
-				for j := 0; j < width; j++ {
-					newPixelData[i][j] = partialResult[i-startY][j]
-				}
+// runTiles splits [0, height) into fixed-height row tiles and runs process on each one using a
+// bounded pool of workers that pull tiles off a job channel until it's drained, rather than the
+// old scheme of spawning exactly `threads` goroutines regardless of image size. Because process
+// writes straight into a shared destination and tiles are disjoint, there's no per-tile
+// allocation or copying back into place afterwards.
+func runTiles(height, threads int, process func(startY, endY int)) {
+	jobs := newTileJobs(height)
+
+	jobChan := make(chan tileJob, len(jobs))
+	for _, job := range jobs {
+		jobChan <- job
+	}
+	close(jobChan)
+
+	workers := workerCount(threads)
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				process(job.startY, job.endY)
 			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runStrategy drives the given filterStrategy over an image of the given dimensions, using
+// runTiles' bounded worker pool to fill a single pre-allocated destination matrix.
+func runStrategy(height, width, threads int, strategy filterStrategy) [][]uint8 {
+	dest := makeMatrix(height, width)
+	runTiles(height, threads, func(startY, endY int) {
+		strategy.filterTile(startY, endY, 0, width, dest)
+	})
+	return dest
+}
+
+// runColorStrategy is runStrategy's counterpart for the color pipelines.
+func runColorStrategy(height, width, threads int, strategy colorFilterStrategy) [][]colorPixel {
+	dest := make([][]colorPixel, height)
+	for i := range dest {
+		dest[i] = make([]colorPixel, width)
+	}
+	runTiles(height, threads, func(startY, endY int) {
+		strategy.filterColorTile(startY, endY, 0, width, dest)
+	})
+	return dest
+}
+
+// filter reads in an image (png, jpeg, tiff or bmp, auto-detected) and writes out a filtered
+// copy. The output codec is chosen from filepathOut's extension (png, jpg/jpeg, tiff/tif, pgm or
+// ppm); quality only applies to JPEG output.
+//
+// When color is true, the filter runs on R, G and B planes instead of collapsing to luminance;
+// colorMode then picks between the "marginal" (per-channel) and "vector" median strategies.
+// radius sets the kernel size to 2*radius+1 in every strategy.
+func filter(filepathIn, filepathOut string, threads int, color bool, colorMode string, radius, quality int) {
+	if radius < 1 {
+		check(fmt.Errorf("filter: radius must be at least 1, got %d", radius))
+	}
+
+	registerFormats()
+
+	img := loadImage(filepathIn)
+	bounds := img.Bounds()
+	height := bounds.Dy()
+	width := bounds.Dx()
+
+	if color {
+		r, g, b := getPixelDataRGB(img)
+		immutableR := makeImmutableMatrix(r)
+		immutableG := makeImmutableMatrix(g)
+		immutableB := makeImmutableMatrix(b)
+
+		var strategy colorFilterStrategy
+		switch colorMode {
+		case "vector":
+			strategy = vectorColorFilter{r: immutableR, g: immutableG, b: immutableB, radius: radius}
+		case "marginal":
+			strategy = marginalColorFilter{r: immutableR, g: immutableG, b: immutableB, radius: radius}
+		default:
+			check(fmt.Errorf("filter: unrecognized colorMode %q", colorMode))
 		}
+
+		newPixelData := runColorStrategy(height, width, threads, strategy)
+
+		imout := image.NewNRGBA(image.Rect(0, 0, width, height))
+		imout.Pix = flattenColorImage(newPixelData)
+		check(writeImage(filepathOut, imout, quality))
+		return
 	}
 
+	immutableData := makeImmutableMatrix(getPixelData(img))
+	newPixelData := runStrategy(height, width, threads, spatialFilter{data: immutableData, radius: radius})
+
 	imout := image.NewGray(image.Rect(0, 0, width, height))
 	imout.Pix = flattenImage(newPixelData)
-	ofp, _ := os.Create(filepathOut)
-	defer ofp.Close()
-	err := png.Encode(ofp, imout)
-	check(err)
+	check(writeImage(filepathOut, imout, quality))
+}
+
+// stackFilter reads in an ordered set of aligned frames from a fixed camera and writes out a
+// single composite image where every pixel is the per-frame median of that position across all
+// frames, so moving subjects disappear and only the static background remains. All frames must
+// share the same bounds; a mismatch is reported before any filtering work starts. Like filter,
+// the output codec is chosen from filepathOut's extension.
+func stackFilter(filepathsIn []string, filepathOut string, threads, quality int) {
+	registerFormats()
+
+	if len(filepathsIn) == 0 {
+		check(fmt.Errorf("stackFilter: no input frames given"))
+	}
+
+	frames := make([]func(y, x int) uint8, len(filepathsIn))
+	var height, width int
+	for i, fp := range filepathsIn {
+		img := loadImage(fp)
+		bounds := img.Bounds()
+		if i == 0 {
+			height = bounds.Dy()
+			width = bounds.Dx()
+		} else if bounds.Dy() != height || bounds.Dx() != width {
+			check(fmt.Errorf("stackFilter: frame %q is %dx%d, expected %dx%d like %q", fp, bounds.Dx(), bounds.Dy(), width, height, filepathsIn[0]))
+		}
+		frames[i] = makeImmutableMatrix(getPixelData(img))
+	}
+
+	newPixelData := runStrategy(height, width, threads, temporalFilter{frames: frames})
+
+	imout := image.NewGray(image.Rect(0, 0, width, height))
+	imout.Pix = flattenImage(newPixelData)
+	check(writeImage(filepathOut, imout, quality))
+}
+
+// multiStringFlag collects every occurrence of a flag into a slice, so -in can be repeated on
+// the command line to list several frames for stackFilter.
+type multiStringFlag []string
+
+func (m *multiStringFlag) String() string {
+	return fmt.Sprint([]string(*m))
 }
 
-// main reads in the filepath flags or sets them to default values and calls filter().
+func (m *multiStringFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+// expandFrames turns the -in flag's contents into a concrete, ordered list of frame paths. A
+// single entry containing glob characters (e.g. "frame*.png") is expanded; anything else,
+// including repeated -in flags, is used as given.
+func expandFrames(raw multiStringFlag) []string {
+	if len(raw) == 1 {
+		if matches, err := filepath.Glob(raw[0]); err == nil && len(matches) > 0 {
+			return matches
+		}
+	}
+	return raw
+}
+
+// main reads in the filepath flags or sets them to default values and calls filter() or, when
+// -stack is set, stackFilter().
 func main() {
-	var filepathIn string
+	var filepathIn multiStringFlag
 	var filepathOut string
 	var threads int
+	var stack bool
+	var color bool
+	var colorMode string
+	var radius int
+	var quality int
 
-	flag.StringVar(
+	flag.Var(
 		&filepathIn,
 		"in",
-		"ship.png",
-		"Specify the input file.")
+		"Specify the input file. Repeat -in, or pass a glob like \"frame*.png\", to list multiple frames for -stack.")
 
 	flag.StringVar(
 		&filepathOut,
@@ -190,9 +776,48 @@ func main() {
 	flag.IntVar(
 		&threads,
 		"threads",
-		1,
-		"Specify the number of worker threads to use.")
+		0,
+		"Specify the number of worker threads to use (0 means use every available CPU).")
+
+	flag.BoolVar(
+		&stack,
+		"stack",
+		false,
+		"Treat -in as an ordered set of aligned frames and run temporal median stacking instead of the spatial filter.")
+
+	flag.BoolVar(
+		&color,
+		"color",
+		false,
+		"Filter R, G and B planes instead of collapsing to grayscale, writing an NRGBA output image.")
+
+	flag.StringVar(
+		&colorMode,
+		"colorMode",
+		"marginal",
+		"With -color, pick the per-channel \"marginal\" median or the \"vector\" median filter.")
+
+	flag.IntVar(
+		&radius,
+		"radius",
+		2,
+		"Specify the median filter's kernel radius; the kernel is (2*radius+1) square.")
+
+	flag.IntVar(
+		&quality,
+		"quality",
+		95,
+		"Specify the JPEG quality to use when -out ends in .jpg or .jpeg.")
 
 	flag.Parse()
-	filter(filepathIn, filepathOut, threads)
+
+	if len(filepathIn) == 0 {
+		filepathIn = multiStringFlag{"ship.png"}
+	}
+
+	if stack {
+		stackFilter(expandFrames(filepathIn), filepathOut, threads, quality)
+	} else {
+		filter(filepathIn[0], filepathOut, threads, color, colorMode, radius, quality)
+	}
 }
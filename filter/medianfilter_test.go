@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// bruteForceMedian computes the NxN (N = 2*radius+1) median at (y, x) by sorting every sample in
+// the window, independently of medianFilter/slidingMedianRow's sliding histogram.
+func bruteForceMedian(y, x, radius int, data func(y, x int) uint8) uint8 {
+	kernelSize := 2*radius + 1
+	samples := make([]int, 0, kernelSize*kernelSize)
+	for k := y - radius; k <= y+radius; k++ {
+		for l := x - radius; l <= x+radius; l++ {
+			samples = append(samples, int(data(k, l)))
+		}
+	}
+	sort.Ints(samples)
+	return uint8(samples[(len(samples)+1)/2-1])
+}
+
+func TestMedianFilterMatchesBruteForce(t *testing.T) {
+	const height, width = 40, 40
+
+	rng := rand.New(rand.NewSource(1))
+	pixels := makeMatrix(height, width)
+	for i := range pixels {
+		for j := range pixels[i] {
+			pixels[i][j] = uint8(rng.Intn(256))
+		}
+	}
+	data := makeImmutableMatrix(pixels)
+
+	for _, radius := range []int{1, 2, 3, 5} {
+		dest := makeMatrix(height, width)
+		medianFilter(0, height, 0, width, radius, height, width, data, dest)
+
+		for y := radius; y < height-radius; y++ {
+			for x := radius; x < width-radius; x++ {
+				want := bruteForceMedian(y, x, radius, data)
+				if got := dest[y][x]; got != want {
+					t.Fatalf("radius=%d (%d,%d): got %d, want %d", radius, y, x, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestMedianFilterTileBordersMatchFullImage(t *testing.T) {
+	const height, width, radius = 32, 32, 2
+
+	rng := rand.New(rand.NewSource(2))
+	pixels := makeMatrix(height, width)
+	for i := range pixels {
+		for j := range pixels[i] {
+			pixels[i][j] = uint8(rng.Intn(256))
+		}
+	}
+	data := makeImmutableMatrix(pixels)
+
+	full := makeMatrix(height, width)
+	medianFilter(0, height, 0, width, radius, height, width, data, full)
+
+	// Simulate two disjoint tiles, as runTiles would hand out, writing into one shared dest.
+	tiled := makeMatrix(height, width)
+	medianFilter(0, height/2, 0, width, radius, height, width, data, tiled)
+	medianFilter(height/2, height, 0, width, radius, height, width, data, tiled)
+
+	for y := radius; y < height-radius; y++ {
+		for x := radius; x < width-radius; x++ {
+			if tiled[y][x] != full[y][x] {
+				t.Fatalf("tile seam at (%d,%d): got %d, want %d", y, x, tiled[y][x], full[y][x])
+			}
+		}
+	}
+}
+
+// putIFDEntry writes one 12-byte TIFF IFD directory entry at entries[i*12:] for a SHORT-typed
+// (type 3) single-value tag.
+func putIFDEntry(order binary.ByteOrder, entries []byte, i int, tag uint16, value uint16) {
+	e := entries[i*12:]
+	order.PutUint16(e[0:2], tag)
+	order.PutUint16(e[2:4], 3) // type 3: SHORT
+	order.PutUint32(e[4:8], 1) // count
+	order.PutUint16(e[8:10], value)
+}
+
+// buildEXIFBlob assembles a minimal TIFF-structured EXIF blob (header + IFD0) containing a single
+// Orientation (0x0112) entry, in the given byte order.
+func buildEXIFBlob(order binary.ByteOrder, littleEndian bool, orientation uint16) []byte {
+	const ifdOffset = 8
+	blob := make([]byte, ifdOffset+2+12+4)
+
+	if littleEndian {
+		copy(blob[0:2], "II")
+	} else {
+		copy(blob[0:2], "MM")
+	}
+	order.PutUint16(blob[2:4], 42)
+	order.PutUint32(blob[4:8], ifdOffset)
+
+	order.PutUint16(blob[ifdOffset:ifdOffset+2], 1) // one entry
+	putIFDEntry(order, blob[ifdOffset+2:], 0, 0x0112, orientation)
+
+	return blob
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	tests := []struct {
+		name         string
+		order        binary.ByteOrder
+		littleEndian bool
+		orientation  uint16
+	}{
+		{"little-endian upright", binary.LittleEndian, true, 1},
+		{"little-endian rotate-180", binary.LittleEndian, true, 3},
+		{"big-endian rotate-90-cw", binary.BigEndian, false, 6},
+		{"big-endian rotate-270-cw", binary.BigEndian, false, 8},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			blob := buildEXIFBlob(tc.order, tc.littleEndian, tc.orientation)
+			if got := exifOrientation(blob); got != int(tc.orientation) {
+				t.Fatalf("exifOrientation() = %d, want %d", got, tc.orientation)
+			}
+		})
+	}
+}
+
+func TestEXIFOrientationMissingTagDefaultsToOne(t *testing.T) {
+	// An IFD0 with zero entries: no Orientation tag present anywhere.
+	blob := make([]byte, 10)
+	copy(blob[0:2], "II")
+	binary.LittleEndian.PutUint16(blob[2:4], 42)
+	binary.LittleEndian.PutUint32(blob[4:8], 8)
+	binary.LittleEndian.PutUint16(blob[8:10], 0) // zero entries
+
+	if got := exifOrientation(blob); got != 1 {
+		t.Fatalf("exifOrientation() = %d, want 1", got)
+	}
+}
+
+func TestEXIFOrientationMalformedBlobDefaultsToOne(t *testing.T) {
+	for _, blob := range [][]byte{
+		nil,
+		{0x00, 0x01, 0x02},
+		[]byte("XX\x00\x00\x00\x00\x00\x00"),
+	} {
+		if got := exifOrientation(blob); got != 1 {
+			t.Fatalf("exifOrientation(%v) = %d, want 1", blob, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestNewTileJobsCoversRangeWithoutOverlap(t *testing.T) {
+	tests := []struct {
+		height int
+	}{
+		{0}, {1}, {tileHeight}, {tileHeight - 1}, {tileHeight + 1}, {3 * tileHeight}, {3*tileHeight + 17},
+	}
+
+	for _, tc := range tests {
+		jobs := newTileJobs(tc.height)
+
+		covered := 0
+		for i, job := range jobs {
+			if job.startY != covered {
+				t.Fatalf("height=%d: job %d starts at %d, want %d (jobs must be contiguous)", tc.height, i, job.startY, covered)
+			}
+			if job.endY <= job.startY {
+				t.Fatalf("height=%d: job %d is empty or inverted: [%d,%d)", tc.height, i, job.startY, job.endY)
+			}
+			if job.endY-job.startY > tileHeight {
+				t.Fatalf("height=%d: job %d spans %d rows, want at most tileHeight=%d", tc.height, i, job.endY-job.startY, tileHeight)
+			}
+			covered = job.endY
+		}
+		if covered != tc.height {
+			t.Fatalf("height=%d: jobs cover up to row %d, want %d", tc.height, covered, tc.height)
+		}
+	}
+}
+
+func TestWorkerCount(t *testing.T) {
+	if got := workerCount(4); got != 4 {
+		t.Fatalf("workerCount(4) = %d, want 4", got)
+	}
+	if got := workerCount(0); got != runtime.NumCPU() {
+		t.Fatalf("workerCount(0) = %d, want runtime.NumCPU() = %d", got, runtime.NumCPU())
+	}
+}
+
+func TestRunTilesCoversEveryRowExactlyOnce(t *testing.T) {
+	const height = 200
+
+	for _, threads := range []int{1, 2, 3, 8, 0} {
+		var mu sync.Mutex
+		seen := make([]int, 0, height)
+
+		runTiles(height, threads, func(startY, endY int) {
+			var rows []int
+			for y := startY; y < endY; y++ {
+				rows = append(rows, y)
+			}
+			mu.Lock()
+			seen = append(seen, rows...)
+			mu.Unlock()
+		})
+
+		if len(seen) != height {
+			t.Fatalf("threads=%d: runTiles visited %d rows, want %d", threads, len(seen), height)
+		}
+		sort.Ints(seen)
+		for y := 0; y < height; y++ {
+			if seen[y] != y {
+				t.Fatalf("threads=%d: row %d missing or duplicated in visited set %v", threads, y, seen)
+			}
+		}
+	}
+}
+
+func TestRunTilesHandlesZeroHeight(t *testing.T) {
+	calls := 0
+	runTiles(0, 2, func(startY, endY int) { calls++ })
+	if calls != 0 {
+		t.Fatalf("runTiles(0, ...) invoked process %d times, want 0", calls)
+	}
+}
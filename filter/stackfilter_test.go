@@ -0,0 +1,97 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMedianOfFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []uint8
+		want   uint8
+	}{
+		{"odd count", []uint8{10, 200, 50}, 50},
+		{"even count takes lower middle", []uint8{10, 20, 30, 40}, 20},
+		{"single frame", []uint8{77}, 77},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			frames := make([]func(y, x int) uint8, len(tc.values))
+			for i, v := range tc.values {
+				v := v
+				frames[i] = func(y, x int) uint8 { return v }
+			}
+			if got := medianOfFrames(0, 0, frames); got != tc.want {
+				t.Fatalf("medianOfFrames() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTemporalFilterRemovesMovingObject(t *testing.T) {
+	// Three aligned 1x3 frames: the static background is 0, and a "moving object" (255) occupies
+	// a different pixel in each frame, so the per-pixel temporal median should recover the
+	// background everywhere.
+	backgrounds := [][]uint8{
+		{255, 0, 0},
+		{0, 255, 0},
+		{0, 0, 255},
+	}
+	frames := make([]func(y, x int) uint8, len(backgrounds))
+	for i, row := range backgrounds {
+		row := row
+		frames[i] = func(y, x int) uint8 { return row[x] }
+	}
+
+	dest := makeMatrix(1, 3)
+	temporalFilter{frames: frames}.filterTile(0, 1, 0, 3, dest)
+
+	for x := 0; x < 3; x++ {
+		if dest[0][x] != 0 {
+			t.Fatalf("dest[0][%d] = %d, want 0 (background)", x, dest[0][x])
+		}
+	}
+}
+
+// writeTestPNG writes a solid-gray width x height PNG to dir/name and returns its path.
+func writeTestPNG(t *testing.T, dir, name string, width, height int) string {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("os.Create: %v", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return path
+}
+
+func TestStackFilterRejectsMismatchedFrameSizes(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestPNG(t, dir, "a.png", 8, 8)
+	b := writeTestPNG(t, dir, "b.png", 8, 4)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("stackFilter with mismatched frame sizes did not panic")
+		}
+	}()
+	stackFilter([]string{a, b}, filepath.Join(dir, "out.png"), 1, 95)
+}
+
+func TestStackFilterRejectsNoFrames(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("stackFilter with no frames did not panic")
+		}
+	}()
+	stackFilter(nil, filepath.Join(t.TempDir(), "out.png"), 1, 95)
+}